@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// scheduleClearAfter snapshots newContent alongside whatever was on the
+// clipboard before it (if anything), then forks a detached copy of the
+// current binary that sleeps for seconds and restores/blanks the clipboard.
+// The parent returns immediately; the worker does the waiting.
+func scheduleClearAfter(newContent, prevContent string, hadPrev bool, selection string, seconds int) error {
+	dir, err := os.MkdirTemp("", "cb-clear-after")
+	if err != nil {
+		return err
+	}
+
+	newFile := filepath.Join(dir, "new")
+	if err := os.WriteFile(newFile, []byte(newContent), 0600); err != nil {
+		return err
+	}
+
+	var prevFile string
+	if hadPrev {
+		prevFile = filepath.Join(dir, "prev")
+		if err := os.WriteFile(prevFile, []byte(prevContent), 0600); err != nil {
+			return err
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	devnull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer devnull.Close()
+
+	args := []string{
+		exe,
+		"--clear-after-worker",
+		"--worker-new", newFile,
+		"--worker-prev", prevFile,
+		"--worker-selection", selection,
+		"--worker-seconds", strconv.Itoa(seconds),
+	}
+
+	proc, err := os.StartProcess(exe, args, &os.ProcAttr{
+		Files: []*os.File{devnull, devnull, devnull},
+		Sys:   detachedProcAttr(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return proc.Release()
+}
+
+// runClearAfterWorker is the detached process launched by scheduleClearAfter.
+// It waits, then restores the pre-copy clipboard value (or blanks it if
+// there wasn't one) - but only if the clipboard still holds what cb wrote,
+// so a later copy in the meantime is never clobbered.
+func runClearAfterWorker(newFile, prevFile, selection string, seconds int) error {
+	defer os.RemoveAll(filepath.Dir(newFile))
+
+	time.Sleep(time.Duration(seconds) * time.Second)
+
+	newContent, err := os.ReadFile(newFile)
+	if err != nil {
+		return err
+	}
+
+	current, err := readClipboard(selection)
+	if err != nil {
+		return err
+	}
+
+	if current != string(newContent) {
+		// Something else already changed the clipboard; leave it be.
+		return nil
+	}
+
+	if prevFile != "" {
+		prevContent, err := os.ReadFile(prevFile)
+		if err == nil {
+			return copyToClipboard(string(prevContent), selection, "")
+		}
+	}
+
+	return clearClipboard(selection)
+}
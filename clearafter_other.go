@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "syscall"
+
+// detachedProcAttr has no Setsid equivalent wired up on this platform; the
+// worker process is still started, just without a fresh session.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}
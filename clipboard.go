@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Unsupported is set by detectClipboardTool when no clipboard mechanism is
+// available for the current platform. Callers should check it and fall back
+// to --no-clipboard style behavior instead of exiting with an error.
+var Unsupported bool
+
+const plan9Snarf = "/dev/snarf"
+
+// isTermux reports whether we're running inside a Termux (Android) environment.
+func isTermux() bool {
+	return os.Getenv("PREFIX") != "" && strings.Contains(os.Getenv("PREFIX"), "com.termux")
+}
+
+// detectClipboardTool picks the best available clipboard command for the
+// current OS/session, trying tools in a documented fallback order:
+//
+//	darwin:  pbcopy
+//	windows: powershell.exe Set-Clipboard
+//	plan9:   /dev/snarf (handled directly by copyToClipboard/clearClipboard)
+//	termux:  termux-clipboard-set
+//	linux:   wl-copy (if WAYLAND_DISPLAY set) -> xclip (if DISPLAY set) -> xsel -> wl-copy/xclip/xsel regardless of env
+//
+// If nothing is found it sets Unsupported and returns "".
+func detectClipboardTool() string {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("pbcopy"); err == nil {
+			return "pbcopy"
+		}
+
+	case "windows":
+		if _, err := exec.LookPath("powershell.exe"); err == nil {
+			return "powershell.exe"
+		}
+
+	case "plan9":
+		return "plan9-snarf"
+
+	default:
+		if isTermux() {
+			if _, err := exec.LookPath("termux-clipboard-set"); err == nil {
+				return "termux-clipboard-set"
+			}
+		}
+
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			if _, err := exec.LookPath("wl-copy"); err == nil {
+				return "wl-copy"
+			}
+		}
+
+		if os.Getenv("DISPLAY") != "" {
+			if _, err := exec.LookPath("xclip"); err == nil {
+				return "xclip"
+			}
+			if _, err := exec.LookPath("xsel"); err == nil {
+				return "xsel"
+			}
+		}
+
+		// Neither env var was set (e.g. run over SSH without X forwarding) but
+		// a tool may still be installed and usable, so try them regardless.
+		if _, err := exec.LookPath("wl-copy"); err == nil {
+			return "wl-copy"
+		}
+		if _, err := exec.LookPath("xclip"); err == nil {
+			return "xclip"
+		}
+		if _, err := exec.LookPath("xsel"); err == nil {
+			return "xsel"
+		}
+	}
+
+	Unsupported = true
+	return ""
+}
+
+// clipboardArgs builds the argument list for tool given the requested
+// selection (clipboard/primary/secondary) and format (a MIME type, or "" for
+// plain text). Tools that don't support a knob simply ignore it.
+func clipboardArgs(tool, selection, format string) []string {
+	switch tool {
+	case "xclip":
+		args := []string{"-selection", selection}
+		if format != "" {
+			args = append(args, "-t", format)
+		}
+		return args
+
+	case "wl-copy":
+		var args []string
+		switch selection {
+		case "primary":
+			args = append(args, "--primary")
+		case "secondary":
+			// wl-copy has no secondary selection; fall back to clipboard.
+		}
+		if format != "" {
+			args = append(args, "--type", format)
+		}
+		return args
+
+	case "xsel":
+		switch selection {
+		case "primary":
+			return []string{"--primary", "--input"}
+		case "secondary":
+			return []string{"--secondary", "--input"}
+		default:
+			return []string{"--clipboard", "--input"}
+		}
+
+	case "powershell.exe":
+		return []string{"-NoProfile", "-Command", "$input | Set-Clipboard"}
+
+	default:
+		// pbcopy, termux-clipboard-set, plan9-snarf: no selection/format knobs.
+		return []string{}
+	}
+}
+
+func copyToClipboard(content, selection, format string) error {
+	tool := detectClipboardTool()
+	if tool == "" {
+		return fmt.Errorf("no clipboard tool found for %s", runtime.GOOS)
+	}
+
+	if tool == "plan9-snarf" {
+		return writeToFile(plan9Snarf, content, false)
+	}
+
+	cmd := exec.Command(tool, clipboardArgs(tool, selection, format)...)
+	cmd.Stdin = strings.NewReader(content)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("clipboard command failed: %v (stderr: %s)", err, stderr.String())
+	}
+
+	return nil
+}
+
+// detectClipboardReadTool mirrors detectClipboardTool for the read side:
+// wl-paste/xclip -o/xsel -o on Linux, pbpaste on macOS, Get-Clipboard on
+// Windows, termux-clipboard-get on Termux, /dev/snarf on Plan 9.
+func detectClipboardReadTool() string {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("pbpaste"); err == nil {
+			return "pbpaste"
+		}
+
+	case "windows":
+		if _, err := exec.LookPath("powershell.exe"); err == nil {
+			return "powershell.exe"
+		}
+
+	case "plan9":
+		return "plan9-snarf"
+
+	default:
+		if isTermux() {
+			if _, err := exec.LookPath("termux-clipboard-get"); err == nil {
+				return "termux-clipboard-get"
+			}
+		}
+
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			if _, err := exec.LookPath("wl-paste"); err == nil {
+				return "wl-paste"
+			}
+		}
+
+		if os.Getenv("DISPLAY") != "" {
+			if _, err := exec.LookPath("xclip"); err == nil {
+				return "xclip"
+			}
+			if _, err := exec.LookPath("xsel"); err == nil {
+				return "xsel"
+			}
+		}
+
+		if _, err := exec.LookPath("wl-paste"); err == nil {
+			return "wl-paste"
+		}
+		if _, err := exec.LookPath("xclip"); err == nil {
+			return "xclip"
+		}
+		if _, err := exec.LookPath("xsel"); err == nil {
+			return "xsel"
+		}
+	}
+
+	Unsupported = true
+	return ""
+}
+
+func clipboardReadArgs(tool, selection string) []string {
+	switch tool {
+	case "xclip":
+		return []string{"-selection", selection, "-o"}
+
+	case "wl-paste":
+		args := []string{"--no-newline"}
+		if selection == "primary" {
+			args = append(args, "--primary")
+		}
+		return args
+
+	case "xsel":
+		switch selection {
+		case "primary":
+			return []string{"--primary", "--output"}
+		case "secondary":
+			return []string{"--secondary", "--output"}
+		default:
+			return []string{"--clipboard", "--output"}
+		}
+
+	case "powershell.exe":
+		return []string{"-NoProfile", "-Command", "Get-Clipboard"}
+
+	default:
+		// pbpaste, termux-clipboard-get: no selection knob.
+		return []string{}
+	}
+}
+
+// readClipboard returns the current contents of the given selection.
+func readClipboard(selection string) (string, error) {
+	tool := detectClipboardReadTool()
+	if tool == "" {
+		return "", fmt.Errorf("no clipboard read tool found for %s", runtime.GOOS)
+	}
+
+	if tool == "plan9-snarf" {
+		data, err := os.ReadFile(plan9Snarf)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	cmd := exec.Command(tool, clipboardReadArgs(tool, selection)...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("clipboard read failed: %v (stderr: %s)", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+func clearClipboard(selection string) error {
+	tool := detectClipboardTool()
+	if tool == "" {
+		return fmt.Errorf("no clipboard tool found")
+	}
+
+	if tool == "plan9-snarf" {
+		return writeToFile(plan9Snarf, "", false)
+	}
+
+	cmd := exec.Command(tool, clipboardArgs(tool, selection, "")...)
+	cmd.Stdin = strings.NewReader("")
+
+	return cmd.Run()
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// defaultHistoryMax is how many entries the history ring keeps by default.
+const defaultHistoryMax = 100
+
+// HistoryEntry describes one clipboard copy recorded in the history ring.
+type HistoryEntry struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Command   string    `json:"command"`
+	Size      int       `json:"size"`
+	Format    string    `json:"format"`
+	SHA256    string    `json:"sha256"`
+}
+
+// hashHex returns the hex-encoded sha256 of s.
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// historyDir returns the directory that holds the clipboard history ring
+// ($XDG_DATA_HOME/cb/history, falling back to ~/.local/share/cb/history),
+// creating it if necessary.
+func historyDir() (string, error) {
+	base := os.Getenv("XDG_DATA_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "share")
+	}
+
+	dir := filepath.Join(base, "cb", "history")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func historyIndexPath(dir string) string {
+	return filepath.Join(dir, "index.json")
+}
+
+func historyEntryPath(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d", id))
+}
+
+func loadHistoryIndex(dir string) ([]HistoryEntry, error) {
+	data, err := os.ReadFile(historyIndexPath(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func saveHistoryIndex(dir string, entries []HistoryEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(historyIndexPath(dir), data, 0600)
+}
+
+// recordHistory appends content to the clipboard history ring, pruning the
+// oldest entries once there are more than max.
+func recordHistory(content, command, format string, max int) error {
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := loadHistoryIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	nextID := 1
+	if len(entries) > 0 {
+		nextID = entries[len(entries)-1].ID + 1
+	}
+
+	entries = append(entries, HistoryEntry{
+		ID:        nextID,
+		Timestamp: time.Now(),
+		Command:   command,
+		Size:      len(content),
+		Format:    format,
+		SHA256:    hashHex(content),
+	})
+
+	if err := os.WriteFile(historyEntryPath(dir, nextID), []byte(content), 0600); err != nil {
+		return err
+	}
+
+	if max > 0 {
+		for len(entries) > max {
+			os.Remove(historyEntryPath(dir, entries[0].ID))
+			entries = entries[1:]
+		}
+	}
+
+	return saveHistoryIndex(dir, entries)
+}
+
+func historyEntryContent(dir string, id int) (string, error) {
+	data, err := os.ReadFile(historyEntryPath(dir, id))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// nthHistoryEntry returns the entry n back from the most recent copy (1 is
+// the most recent entry).
+func nthHistoryEntry(entries []HistoryEntry, n int) (HistoryEntry, error) {
+	if n <= 0 || n > len(entries) {
+		return HistoryEntry{}, fmt.Errorf("no history entry %d back (have %d entries)", n, len(entries))
+	}
+	return entries[len(entries)-n], nil
+}
+
+// findHistoryEntry looks up an entry by its ring ID, as reported by --list.
+func findHistoryEntry(entries []HistoryEntry, id int) (HistoryEntry, error) {
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return HistoryEntry{}, fmt.Errorf("no history entry with id %d", id)
+}
+
+// searchHistory returns entries whose stored content matches pattern.
+func searchHistory(dir string, entries []HistoryEntry, pattern string) ([]HistoryEntry, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --search pattern: %v", err)
+	}
+
+	var matches []HistoryEntry
+	for _, e := range entries {
+		content, err := historyEntryContent(dir, e.ID)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(content) {
+			matches = append(matches, e)
+		}
+	}
+	return matches, nil
+}
+
+func printHistoryEntries(entries []HistoryEntry) {
+	for _, e := range entries {
+		fmt.Printf("%d\t%s\t%s\t%d bytes\t%s\n", e.ID, e.Timestamp.Format("2006-01-02 15:04:05"), e.Format, e.Size, e.Command)
+	}
+}
+
+// cmdList implements `cb --list`.
+func cmdList() error {
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := loadHistoryIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No clipboard history yet")
+		return nil
+	}
+
+	printHistoryEntries(entries)
+	return nil
+}
+
+// cmdPaste implements `cb --paste [N]`: with no N it prints the current
+// clipboard contents, otherwise the Nth-back history entry.
+func cmdPaste(n int, selection string) error {
+	if n <= 0 {
+		content, err := readClipboard(selection)
+		if err != nil {
+			return err
+		}
+		fmt.Print(content)
+		return nil
+	}
+
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := loadHistoryIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	entry, err := nthHistoryEntry(entries, n)
+	if err != nil {
+		return err
+	}
+
+	content, err := historyEntryContent(dir, entry.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(content)
+	return nil
+}
+
+// cmdRestore implements `cb --restore N`: put history entry N back on the
+// clipboard.
+func cmdRestore(id int, selection string) error {
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := loadHistoryIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	entry, err := findHistoryEntry(entries, id)
+	if err != nil {
+		return err
+	}
+
+	content, err := historyEntryContent(dir, entry.ID)
+	if err != nil {
+		return err
+	}
+
+	return copyToClipboard(content, selection, entry.Format)
+}
+
+// cmdSearch implements `cb --search <regex>`.
+func cmdSearch(pattern string) error {
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := loadHistoryIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	matches, err := searchHistory(dir, entries, pattern)
+	if err != nil {
+		return err
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("No matching history entries")
+		return nil
+	}
+
+	printHistoryEntries(matches)
+	return nil
+}
@@ -2,18 +2,43 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 )
 
 const version = "00.00.001"
 
+var validSelections = map[string]bool{
+	"clipboard": true,
+	"primary":   true,
+	"secondary": true,
+}
+
+var validOutputModes = map[string]bool{
+	"text":   true,
+	"json":   true,
+	"ndjson": true,
+}
+
+// isBinaryFormat reports whether format designates non-text content that
+// must reach the clipboard without ANSI stripping, trimming, or the
+// timestamp header. Text formats (or no format at all) go through the
+// normal rendering path.
+func isBinaryFormat(format string) bool {
+	if format == "" || format == "application/json" {
+		return false
+	}
+	return !strings.HasPrefix(format, "text/")
+}
+
 type Config struct {
 	headLines   int
 	tailLines   int
@@ -31,6 +56,26 @@ type Config struct {
 	trim        bool
 	help        bool
 	showVersion bool
+	selection   string
+	format      string
+	list        bool
+	paste       bool
+	pasteN      int
+	restore     int
+	search      string
+	historyMax  int
+	clearAfter  int
+	watch       string
+	match       string
+	interval    int
+	once        bool
+	output      string
+
+	clearAfterWorker bool
+	workerNew        string
+	workerPrev       string
+	workerSelection  string
+	workerSeconds    int
 }
 
 // quietFlag implements flag.Value for optional integer flag
@@ -65,9 +110,53 @@ func (q *quietFlag) IsBoolFlag() bool {
 	return true
 }
 
+// pasteFlag implements flag.Value for --paste, which is either bare (print
+// the current clipboard) or takes an integer N (print the Nth-back history
+// entry).
+type pasteFlag struct {
+	n   *int
+	set *bool
+}
+
+func (p *pasteFlag) String() string {
+	if *p.set && *p.n == 0 {
+		return "true"
+	}
+	return fmt.Sprintf("%d", *p.n)
+}
+
+func (p *pasteFlag) Set(value string) error {
+	*p.set = true
+	if value == "" || value == "true" {
+		*p.n = 0
+		return nil
+	}
+	var n int
+	_, err := fmt.Sscanf(value, "%d", &n)
+	if err != nil {
+		return err
+	}
+	*p.n = n
+	return nil
+}
+
+func (p *pasteFlag) IsBoolFlag() bool {
+	return true
+}
+
 func main() {
 	config := parseFlags()
 
+	// The detached --clear-after worker re-enters through this same binary;
+	// handle it before anything else expects a wrapped command.
+	if config.clearAfterWorker {
+		if err := runClearAfterWorker(config.workerNew, config.workerPrev, config.workerSelection, config.workerSeconds); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in clear-after worker: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if config.help {
 		printHelp()
 		os.Exit(0)
@@ -78,6 +167,61 @@ func main() {
 		os.Exit(0)
 	}
 
+	if !validSelections[config.selection] {
+		fmt.Fprintf(os.Stderr, "Error: invalid --selection %q (want clipboard, primary, or secondary)\n", config.selection)
+		os.Exit(1)
+	}
+
+	if !validOutputModes[config.output] {
+		fmt.Fprintf(os.Stderr, "Error: invalid --output %q (want text, json, or ndjson)\n", config.output)
+		os.Exit(1)
+	}
+
+	// History subcommands stand alone; they don't run a wrapped command.
+	if config.list {
+		if err := cmdList(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.paste {
+		if err := cmdPaste(config.pasteN, config.selection); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.restore > 0 {
+		if err := cmdRestore(config.restore, config.selection); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.search != "" {
+		if err := cmdSearch(config.search); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.watch != "" {
+		interval := time.Duration(config.interval) * time.Second
+		if interval <= 0 {
+			interval = time.Second
+		}
+		if err := runWatch(config.watch, config.match, config.selection, interval, config.once, config.verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Get command arguments
 	args := flag.Args()
 	if len(args) == 0 {
@@ -86,13 +230,46 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Execute command and capture output
-	output, err := executeCommand(args, config.stderr)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error executing command: %v\n", err)
+	// Binary formats (e.g. image/png) and structured output pass straight
+	// through: no ANSI stripping, trimming, line filtering, or text header,
+	// since any of those would corrupt/mangle the payload.
+	binary := isBinaryFormat(config.format)
+	structured := config.output == "json" || config.output == "ndjson"
+
+	if binary && structured {
+		fmt.Fprintln(os.Stderr, "Error: --format image/* (or other binary format) cannot be combined with --output json/ndjson; the payload would be embedded as a (corrupted) JSON string")
 		os.Exit(1)
 	}
 
+	// Execute command and capture output. stdout and stderr are always
+	// captured separately (even when -e is set) so --output json/ndjson can
+	// report both; -e only picks which one is treated as the text to copy
+	// (and, in plain-text mode, print), see rawOutput below.
+	cmdStart := time.Now()
+	stdoutOut, stderrOut, exitCode, cmdErr := executeCommand(args)
+	durationMs := time.Since(cmdStart).Milliseconds()
+	if cmdErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(cmdErr, &exitErr) {
+			// A non-zero exit from the wrapped command is not a cb error
+			// under --output json/ndjson - it's recorded in exitCode so the
+			// record is complete even for partial failures. Plain text mode
+			// without -e still fails fast, as it always has; with -e the
+			// failing command's stderr is still copied.
+			if !structured && !config.stderr {
+				msg := cmdErr.Error()
+				if stderrOut != "" {
+					msg = fmt.Sprintf("%s (stderr: %s)", msg, stderrOut)
+				}
+				fmt.Fprintf(os.Stderr, "Error executing command: %s\n", msg)
+				os.Exit(1)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Error executing command: %v\n", cmdErr)
+			os.Exit(1)
+		}
+	}
+
 	// Apply delay if specified
 	if config.delay > 0 {
 		if config.verbose {
@@ -101,24 +278,61 @@ func main() {
 		time.Sleep(time.Duration(config.delay) * time.Second)
 	}
 
-	// Strip ANSI codes unless -r/--raw is specified
-	if !config.raw {
-		output = stripANSI(output)
+	rawOutput := stdoutOut
+	if config.stderr {
+		rawOutput = stderrOut
 	}
 
-	// Apply trim if specified
-	if config.trim {
-		output = strings.TrimSpace(output)
+	processedOutput := rawOutput
+	if !config.raw && !binary && !structured {
+		processedOutput = stripANSI(processedOutput)
+	}
+	if config.trim && !binary && !structured {
+		processedOutput = strings.TrimSpace(processedOutput)
+	}
+	if !binary && !structured {
+		processedOutput = applyLineFilters(processedOutput, config.headLines, config.tailLines)
 	}
 
-	// Apply head/tail filtering
-	output = applyLineFilters(output, config.headLines, config.tailLines)
-
-	// Prepare output with timestamp header
 	cmdStr := strings.Join(args, " ")
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	header := fmt.Sprintf("[%s \"%s\"]:\n", timestamp, cmdStr)
-	fullOutput := header + output + "\n"
+
+	bytesCopied := 0
+	if !config.noClipboard && detectClipboardTool() != "" {
+		bytesCopied = len(processedOutput)
+	}
+
+	var output, fullOutput string
+	switch {
+	case structured:
+		host, _ := os.Hostname()
+		record := OutputRecord{
+			Timestamp:     timestamp,
+			Command:       cmdStr,
+			Args:          args,
+			ExitCode:      exitCode,
+			DurationMs:    durationMs,
+			Stdout:        stdoutOut,
+			Stderr:        stderrOut,
+			BytesCopied:   bytesCopied,
+			ClipboardTool: detectClipboardTool(),
+			Host:          host,
+		}
+		rendered, err := renderOutputRecord(record, config.output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error building structured output: %v\n", err)
+			os.Exit(1)
+		}
+		output = rendered
+		fullOutput = rendered
+	case binary:
+		output = processedOutput
+		fullOutput = processedOutput
+	default:
+		output = processedOutput
+		header := fmt.Sprintf("[%s \"%s\"]:\n", timestamp, cmdStr)
+		fullOutput = header + processedOutput + "\n"
+	}
 
 	// Write to file unless --no-temp is specified
 	if !config.noTemp {
@@ -137,21 +351,57 @@ func main() {
 		}
 	}
 
-	// Copy to clipboard unless -n is specified
+	// Copy to clipboard unless -n is specified or no clipboard tool is available
+	if !config.noClipboard {
+		if tool := detectClipboardTool(); tool == "" && Unsupported {
+			if config.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: no clipboard tool found for %s, skipping clipboard\n", runtime.GOOS)
+			}
+			config.noClipboard = true
+		}
+	}
+
 	if !config.noClipboard {
 		if config.clear {
-			if err := clearClipboard(); err != nil && config.verbose {
+			if err := clearClipboard(config.selection); err != nil && config.verbose {
 				fmt.Fprintf(os.Stderr, "Warning: could not clear clipboard: %v\n", err)
 			}
 		}
 
-		if err := copyToClipboard(output); err != nil {
+		// Snapshot whatever's on the clipboard now, before we overwrite it,
+		// so --clear-after can restore it later.
+		var prevContent string
+		var hadPrev bool
+		if config.clearAfter > 0 {
+			if content, err := readClipboard(config.selection); err == nil {
+				prevContent, hadPrev = content, true
+			}
+		}
+
+		// The clipboard always receives the command's own output; under
+		// --output json/ndjson the record goes to the file and stdout only.
+		if err := copyToClipboard(processedOutput, config.selection, config.format); err != nil {
 			fmt.Fprintf(os.Stderr, "Error copying to clipboard: %v\n", err)
 			os.Exit(1)
 		}
 
+		// --clear-after exists to keep secrets off the clipboard long-term;
+		// writing the same content into the history ring right next to it
+		// would defeat the point, so skip the history entry in that case.
+		if config.clearAfter == 0 {
+			if err := recordHistory(processedOutput, cmdStr, config.format, config.historyMax); err != nil && config.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: could not record clipboard history: %v\n", err)
+			}
+		}
+
+		if config.clearAfter > 0 {
+			if err := scheduleClearAfter(processedOutput, prevContent, hadPrev, config.selection, config.clearAfter); err != nil && config.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: could not schedule --clear-after: %v\n", err)
+			}
+		}
+
 		if config.verbose {
-			lines := strings.Count(output, "\n") + 1
+			lines := strings.Count(processedOutput, "\n") + 1
 			fmt.Printf("Copied %d lines to clipboard\n", lines)
 		}
 	}
@@ -201,38 +451,62 @@ func parseFlags() Config {
 	flag.BoolVar(&config.trim, "trim", false, "Trim leading and trailing whitespace")
 	flag.BoolVar(&config.help, "help", false, "Display usage instructions")
 	flag.BoolVar(&config.showVersion, "version", false, "Show program version")
+	flag.StringVar(&config.selection, "selection", "clipboard", "Clipboard selection to target: clipboard, primary, or secondary")
+	flag.StringVar(&config.format, "format", "", "MIME type / format target for clipboard content (e.g. text/plain, text/html, image/png)")
+	flag.BoolVar(&config.list, "list", false, "List clipboard history entries")
+	pFlag := &pasteFlag{n: &config.pasteN, set: &config.paste}
+	flag.Var(pFlag, "paste", "Print the current clipboard, or history entry N back, to stdout")
+	flag.IntVar(&config.restore, "restore", 0, "Put clipboard history entry N back onto the clipboard")
+	flag.StringVar(&config.search, "search", "", "Search clipboard history content by regex")
+	flag.IntVar(&config.historyMax, "history-max", defaultHistoryMax, "Maximum number of entries to keep in the clipboard history ring")
+	flag.IntVar(&config.clearAfter, "clear-after", 0, "Restore (or blank) the clipboard N seconds after copying")
+	flag.StringVar(&config.watch, "watch", "", "Poll the clipboard and pipe changed content through <command>, copying the result back")
+	flag.StringVar(&config.match, "match", "", "Only trigger --watch when clipboard content matches this regex")
+	flag.IntVar(&config.interval, "interval", 1, "Polling interval in seconds for --watch")
+	flag.BoolVar(&config.once, "once", false, "Exit --watch after the first triggered match")
+	flag.StringVar(&config.output, "output", "text", "Output mode: text, json, or ndjson")
+
+	// Internal flags used by the detached --clear-after worker process; not
+	// meant to be set by hand and deliberately left out of printHelp.
+	flag.BoolVar(&config.clearAfterWorker, "clear-after-worker", false, "internal")
+	flag.StringVar(&config.workerNew, "worker-new", "", "internal")
+	flag.StringVar(&config.workerPrev, "worker-prev", "", "internal")
+	flag.StringVar(&config.workerSelection, "worker-selection", "clipboard", "internal")
+	flag.IntVar(&config.workerSeconds, "worker-seconds", 0, "internal")
 
 	flag.Parse()
 
 	return config
 }
 
-func executeCommand(args []string, captureStderr bool) (string, error) {
+// executeCommand runs args, always capturing stdout and stderr into separate
+// buffers - including when -e/--error is set, so --output json/ndjson can
+// still report both streams; -e only changes which one main() treats as the
+// text to print/copy.
+//
+// err is the raw error from cmd.Run(), including *exec.ExitError for a
+// non-zero exit; callers that want to treat a bad exit code as non-fatal
+// (--output json/ndjson) should check errors.As(err, new(*exec.ExitError))
+// rather than requiring err == nil.
+func executeCommand(args []string) (stdout, stderr string, exitCode int, err error) {
 	cmd := exec.Command(args[0], args[1:]...)
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
 
-	if captureStderr {
-		cmd.Stderr = &stdout // Combine stderr with stdout
-	} else {
-		cmd.Stderr = &stderr
-	}
+	runErr := cmd.Run()
+	stdout, stderr = stdoutBuf.String(), stderrBuf.String()
 
-	err := cmd.Run()
-	if err != nil {
-		// Still return the output even if command failed
-		if captureStderr {
-			return stdout.String(), nil
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			return stdout, stderr, exitErr.ExitCode(), runErr
 		}
-		// If there's stderr output, include it in error context
-		if stderr.Len() > 0 {
-			return stdout.String(), fmt.Errorf("%v (stderr: %s)", err, stderr.String())
-		}
-		return stdout.String(), err
+		return stdout, stderr, -1, runErr
 	}
 
-	return stdout.String(), nil
+	return stdout, stderr, 0, nil
 }
 
 func stripANSI(input string) string {
@@ -295,56 +569,6 @@ func writeToFile(path string, content string, appendMode bool) error {
 	return err
 }
 
-func detectClipboardTool() (string, []string) {
-	// Try Wayland first (wl-copy)
-	if _, err := exec.LookPath("wl-copy"); err == nil {
-		return "wl-copy", []string{}
-	}
-
-	// Try X11 (xclip)
-	if _, err := exec.LookPath("xclip"); err == nil {
-		return "xclip", []string{"-selection", "clipboard"}
-	}
-
-	// Try xsel as fallback
-	if _, err := exec.LookPath("xsel"); err == nil {
-		return "xsel", []string{"--clipboard", "--input"}
-	}
-
-	return "", nil
-}
-
-func copyToClipboard(content string) error {
-	tool, args := detectClipboardTool()
-	if tool == "" {
-		return fmt.Errorf("no clipboard tool found (tried: wl-copy, xclip, xsel)")
-	}
-
-	cmd := exec.Command(tool, args...)
-	cmd.Stdin = strings.NewReader(content)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("clipboard command failed: %v (stderr: %s)", err, stderr.String())
-	}
-
-	return nil
-}
-
-func clearClipboard() error {
-	tool, args := detectClipboardTool()
-	if tool == "" {
-		return fmt.Errorf("no clipboard tool found")
-	}
-
-	cmd := exec.Command(tool, args...)
-	cmd.Stdin = strings.NewReader("")
-
-	return cmd.Run()
-}
-
 func printHelp() {
 	fmt.Println(`cb - Command output clipboard manager
 
@@ -368,6 +592,19 @@ Flags:
   -r, --raw         Preserve terminal formatting/ANSI codes
   --delay N         Wait N seconds before copying output
   --trim            Trim leading and trailing whitespace
+  --selection SEL   Clipboard selection to target: clipboard, primary, secondary (default clipboard)
+  --format MIME     Format target for clipboard content, e.g. text/plain, text/html, image/png
+  --list            List clipboard history entries
+  --paste [N]       Print current clipboard, or history entry N back, to stdout
+  --restore N       Put clipboard history entry N back onto the clipboard
+  --search REGEX    Search clipboard history content by regex
+  --history-max N   Maximum number of entries kept in the history ring (default 100)
+  --clear-after N   Restore (or blank) the clipboard N seconds after copying
+  --watch CMD       Poll the clipboard and pipe changed content through CMD, copying the result back
+  --match REGEX     Only trigger --watch when clipboard content matches REGEX
+  --interval N      Polling interval in seconds for --watch (default 1)
+  --once            Exit --watch after the first triggered match
+  --output MODE     Output mode: text, json, or ndjson (default text)
   --version         Show program version
   --help            Display this help message
 
@@ -377,8 +614,25 @@ Examples:
   cb -h 10 dmesg
   cb -f output.txt -v ps aux
   cb -e -v somecommand
+  cb --selection primary xclip-selection-demo
+  cb --format image/png screenshot
+  cb --list
+  cb --paste=2
+  cb --restore 5
+  cb --search 'sk-[a-z0-9]+'
+  cb --clear-after 5 pass show github/token
+  cb --watch 'jq .'
+  cb --match 'https?://' --once --watch 'yt-dlp -g'
+  cb -n --output ndjson -a -f audit.jsonl some-command
 
 Notes:
-  - Requires wl-copy (Wayland) or xclip/xsel (X11) for clipboard support
-  - Output is saved with timestamp header: [date time "command"]:`)
+  - Requires pbcopy (macOS), PowerShell (Windows), /dev/snarf (Plan 9),
+    termux-clipboard-set (Termux), or wl-copy/xclip/xsel (Linux X11/Wayland)
+  - Text output is saved with timestamp header: [date time "command"]:
+  - Binary formats (anything outside text/* and application/json) skip the
+    header and ANSI stripping so raw bytes reach the clipboard intact
+  - Clipboard history is kept in $XDG_DATA_HOME/cb/history (or
+    ~/.local/share/cb/history), capped at --history-max entries
+  - --output json/ndjson replaces the header with a structured record and
+    never fails cb just because the wrapped command exited non-zero`)
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// OutputRecord is the structured record emitted by --output json/ndjson in
+// place of the usual [timestamp "cmd"]: header, suitable for audit logging
+// or piping into jq.
+type OutputRecord struct {
+	Timestamp     string   `json:"timestamp"`
+	Command       string   `json:"command"`
+	Args          []string `json:"args"`
+	ExitCode      int      `json:"exit_code"`
+	DurationMs    int64    `json:"duration_ms"`
+	Stdout        string   `json:"stdout"`
+	Stderr        string   `json:"stderr"`
+	BytesCopied   int      `json:"bytes_copied"`
+	ClipboardTool string   `json:"clipboard_tool"`
+	Host          string   `json:"host"`
+}
+
+// renderOutputRecord serializes record per mode: "json" is pretty-printed,
+// "ndjson" is a single compact line so multiple records can be appended to
+// the same file and read back one-per-line.
+func renderOutputRecord(record OutputRecord, mode string) (string, error) {
+	if mode == "ndjson" {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
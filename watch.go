@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// runWatch polls the clipboard at interval and, whenever its content
+// changes and (optionally) matches pattern, pipes it through command as
+// stdin and copies the command's stdout back onto the clipboard. It
+// debounces against its own writes by comparing content hashes, so copying
+// the result back doesn't immediately re-trigger itself on the next poll.
+func runWatch(command, pattern, selection string, interval time.Duration, once, verbose bool) error {
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --match pattern: %v", err)
+		}
+	}
+
+	// Content already on the clipboard at start is not a change.
+	initial, err := readClipboard(selection)
+	if err != nil {
+		return err
+	}
+	seenHash := hashHex(initial)
+	var writtenHash string
+
+	for {
+		content, err := readClipboard(selection)
+		if err != nil {
+			return err
+		}
+
+		hash := hashHex(content)
+		if hash == seenHash {
+			time.Sleep(interval)
+			continue
+		}
+		seenHash = hash
+
+		if hash == writtenHash {
+			// Our own write from a previous iteration; not an external copy.
+			time.Sleep(interval)
+			continue
+		}
+
+		if re != nil && !re.MatchString(content) {
+			time.Sleep(interval)
+			continue
+		}
+
+		result, err := runWatchCommand(command, content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: --watch command failed: %v\n", err)
+			time.Sleep(interval)
+			continue
+		}
+
+		if err := copyToClipboard(result, selection, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not copy --watch result: %v\n", err)
+			time.Sleep(interval)
+			continue
+		}
+
+		writtenHash = hashHex(result)
+		seenHash = writtenHash
+
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Watch: ran %q, copied %d bytes\n", command, len(result))
+		}
+
+		if once {
+			return nil
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func runWatchCommand(command, input string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(input)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v (stderr: %s)", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}